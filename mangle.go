@@ -45,6 +45,7 @@ import (
 	"github.com/jimsmart/bufrr"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 	"unicode"
@@ -58,6 +59,36 @@ type Mangle struct {
 	// A sufficiently long secret, used as a salt so rainbow tables cannot be
 	// used to reverse the hashes.
 	Secret string
+	// PreserveEntities controls how MangleHTML emits text nodes. The HTML
+	// tokenizer decodes character references (e.g. "&eacute;") to UTF-8
+	// before MangleString ever sees them, which is fine for plain text
+	// output but produces raw non-ASCII bytes inside what should remain
+	// HTML markup. When PreserveEntities is true, mangled text is
+	// re-encoded with named character references (see mangle_entities.go)
+	// so the output is still valid HTML and entity boundaries match the
+	// source; when false (the default), the decoded UTF-8 is emitted as-is.
+	PreserveEntities bool
+	// TagPolicy controls which tags have their text content preserved
+	// verbatim and which attributes are mangled rather than copied as-is.
+	// The zero value mangles every attribute listed in MangleAttrs (none,
+	// by default) and preserves the rest, matching MangleHTML's historic
+	// behaviour of copying all attributes through unchanged. See
+	// DefaultTagPolicy and mangle_tagpolicy.go.
+	TagPolicy TagPolicy
+	// Detectors run over text before the word tokenizer in MangleString and
+	// MangleIO, replacing structured, format-sensitive data (emails, URLs,
+	// phone numbers, dates, IP addresses) with a deterministic,
+	// format-preserving mask instead of letting it fall through to
+	// unrelated corpus words. See mangle_detectors.go.
+	Detectors []Detector
+	// AuditSink, if set, is called for every replacement MangleString and
+	// MangleIO make - word or detector match alike - so callers can build a
+	// reversible log for use with Unmangle. See mangle_audit.go. MangleHTML,
+	// MangleCode and MangleMarkdown mangle their input piece by piece, so
+	// their records carry offsets relative to each piece rather than to the
+	// whole output, and Unmangle does not reverse their output; identifiers
+	// replaced by MangleCode are not recorded at all.
+	AuditSink AuditSink
 }
 
 // ReadCorpus is a helper function that opens and reads a corpus file of words
@@ -92,22 +123,65 @@ func BuildCorpus(scanner *bufio.Scanner) ([255][]string, error) {
 }
 
 // MangleString operates on strings, and is preferable if you have many short
-// strings to operate on.
+// strings to operate on. If Detectors are configured, each is run over s
+// first so structured data (emails, URLs, phone numbers, dates, IPs) is
+// format-preservingly masked instead of falling through to the word
+// tokenizer below. If AuditSink is configured, it is called for every
+// replacement made, word or detector match alike.
 func (m Mangle) MangleString(s string) string {
+	if len(m.Detectors) == 0 {
+		output, _ := m.mangleWords(s, 0)
+		return output
+	}
+	var output string
+	var offset int64
+	text := []byte(s)
+	for len(text) > 0 {
+		detector, start, end, kind := m.detectorMatch(text)
+		if detector == nil {
+			out, _ := m.mangleWords(string(text), offset)
+			output += out
+			break
+		}
+		out, newOffset := m.mangleWords(string(text[:start]), offset)
+		output += out
+		offset = newOffset
+
+		original := text[start:end]
+		replacement := detector.Mangle(original, m.Secret)
+		m.recordDetectorMatch(original, replacement, offset, kind)
+		output += string(replacement)
+		offset += int64(len(replacement))
+		text = text[end:]
+	}
+	return output
+}
+
+// mangleWords performs the original word-by-word mangling: every run of
+// letters or numbers is replaced via mangleWord, and everything else
+// (punctuation, whitespace, tags) is passed through unchanged. offset is the
+// byte offset within the overall mangled output at which this call's output
+// starts, used to label AuditSink records, and is returned advanced by the
+// length of that output.
+func (m Mangle) mangleWords(s string, offset int64) (string, int64) {
 	var output string
 	var word []rune
+	var wordOffset int64
 	runes := []rune(s)
 	strlen := len(runes)
 	for i := 0; i < strlen; i++ {
 		rune := runes[i]
 		if unicode.IsLetter(rune) || unicode.IsNumber(rune) {
 			// In word.
+			if len(word) == 0 {
+				wordOffset = offset + int64(len(output))
+			}
 			word = append(word, rune)
 		} else {
 			// Inter-word.
 			if len(word) > 0 {
 				// Process previous word.
-				output += m.mangleWord(word)
+				output += m.mangleRecordedWord(word, wordOffset)
 				// Reset word.
 				word = word[0:0]
 			}
@@ -115,8 +189,61 @@ func (m Mangle) MangleString(s string) string {
 		}
 	}
 	// Process last word.
-	output += m.mangleWord(word)
-	return output
+	output += m.mangleRecordedWord(word, wordOffset)
+	return output, offset + int64(len(output))
+}
+
+// mangleRecordedWord mangles word and, if AuditSink is configured, records
+// the (original, replacement) pair at offset.
+func (m Mangle) mangleRecordedWord(word []rune, offset int64) string {
+	replacement := m.mangleWord(word)
+	if len(word) > 0 && m.AuditSink != nil {
+		m.AuditSink.Record(string(word), replacement, offset, "word")
+	}
+	return replacement
+}
+
+// recordDetectorMatch records a detector's replacement for AuditSink,
+// mirroring how Unmangle's plain word scanner will later read the mangled
+// output: Unmangle only recognises maximal runs of letters/numbers as
+// replaceable words, so rather than recording the whole match as one unit
+// (which Unmangle would never reconstruct, since it never looks up
+// punctuation-spanning substrings), this walks replacement and original in
+// lockstep and records each such run separately, at its own offset. This
+// relies on built-in detectors keeping original and replacement the same
+// length with punctuation in the same positions; if a detector changes the
+// match's length in runes, the whole match is recorded instead, for Unmangle
+// to ignore.
+func (m Mangle) recordDetectorMatch(original, replacement []byte, offset int64, kind string) {
+	if m.AuditSink == nil {
+		return
+	}
+	origRunes, replRunes := []rune(string(original)), []rune(string(replacement))
+	if len(origRunes) != len(replRunes) {
+		m.AuditSink.Record(string(original), string(replacement), offset, kind)
+		return
+	}
+	var origRun, replRun []rune
+	var runOffset int64
+	flush := func() {
+		if len(replRun) > 0 {
+			m.AuditSink.Record(string(origRun), string(replRun), runOffset, kind)
+		}
+		origRun, replRun = origRun[:0], replRun[:0]
+	}
+	for i, r := range replRunes {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if len(replRun) == 0 {
+				runOffset = offset
+			}
+			origRun = append(origRun, origRunes[i])
+			replRun = append(replRun, r)
+		} else {
+			flush()
+		}
+		offset += int64(len(string(r)))
+	}
+	flush()
 }
 
 // MangleHTML operates on HTML using an io interface, preserving all HTML tags
@@ -130,11 +257,23 @@ func (m Mangle) MangleHTML(r io.Reader, w io.Writer) error {
 	return err
 }
 
-// MangleIO operates on an io interface, parsing as plain text, and is preferable for long strings.
+// MangleIO operates on an io interface, parsing as plain text, and is
+// preferable for long strings. When Detectors are configured, the reader is
+// buffered in full and run through MangleString, since detecting structured
+// data such as URLs requires looking ahead past a single rune at a time.
 func (m Mangle) MangleIO(r io.Reader, w io.Writer) error {
+	if len(m.Detectors) > 0 {
+		source, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, m.MangleString(string(source)))
+		return nil
+	}
 	var word []rune
 	var rune rune
 	var err error
+	var offset, wordOffset int64
 	bufr := bufrr.NewReader(r)
 	for {
 		rune, _, err = bufr.ReadRune()
@@ -143,28 +282,40 @@ func (m Mangle) MangleIO(r io.Reader, w io.Writer) error {
 		}
 		if rune == bufrr.EOF {
 			// Process last word.
-			fmt.Fprint(w, m.mangleWord(word))
+			fmt.Fprint(w, m.mangleRecordedWord(word, wordOffset))
 			return nil
 		}
 		if unicode.IsLetter(rune) || unicode.IsNumber(rune) {
 			// In word.
+			if len(word) == 0 {
+				wordOffset = offset
+			}
 			word = append(word, rune)
 		} else {
 			// Inter-word.
 			if len(word) > 0 {
 				// Process previous word.
-				fmt.Fprint(w, m.mangleWord(word))
+				replacement := m.mangleRecordedWord(word, wordOffset)
+				fmt.Fprint(w, replacement)
+				offset += int64(len(replacement))
 				// Reset word.
 				word = word[0:0]
 			}
 			fmt.Fprint(w, string(rune))
+			offset += int64(len(string(rune)))
 		}
 	}
 }
 
-// Operates the HTML tokenizer, skipping tags but mangling content.
+// Operates the HTML tokenizer, skipping tags but mangling content. Start and
+// self-closing tags are reconstructed attribute-by-attribute (rather than
+// copied raw) so the TagPolicy can mangle or preserve individual attribute
+// values, and a stack of open tags is kept so text inside a PreserveText tag
+// (e.g. script, style) is copied through untouched.
 func (m Mangle) mangleHTMLParser(r io.Reader, w io.Writer) error {
+	policy := m.TagPolicy
 	z := html.NewTokenizer(r)
+	var stack []string
 	for {
 		tt := z.Next()
 		switch tt {
@@ -172,13 +323,67 @@ func (m Mangle) mangleHTMLParser(r io.Reader, w io.Writer) error {
 			return z.Err()
 		case html.TextToken:
 			token := string(z.Text())
-			fmt.Fprint(w, m.MangleString(token))
+			if preserveTextStack(stack, policy) {
+				fmt.Fprint(w, token)
+				continue
+			}
+			mangled := m.MangleString(token)
+			if m.PreserveEntities {
+				mangled = escapeHTMLEntities(mangled)
+			}
+			fmt.Fprint(w, mangled)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tagName := string(name)
+			fmt.Fprintf(w, "<%s", tagName)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrName := string(key)
+				attrVal := string(val)
+				if policy.mangleAttr(tagName, attrName) {
+					attrVal = m.MangleString(attrVal)
+				}
+				fmt.Fprintf(w, " %s=\"%s\"", attrName, escapeAttrValue(attrVal))
+			}
+			if tt == html.SelfClosingTagToken {
+				fmt.Fprint(w, "/>")
+			} else {
+				fmt.Fprint(w, ">")
+				stack = append(stack, tagName)
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tagName := string(name)
+			fmt.Fprintf(w, "</%s>", tagName)
+			if len(stack) > 0 && stack[len(stack)-1] == tagName {
+				stack = stack[:len(stack)-1]
+			}
 		default:
 			fmt.Fprint(w, string(z.Raw()))
 		}
 	}
 }
 
+// preserveTextStack reports whether any currently open tag requests its
+// text content be preserved verbatim.
+func preserveTextStack(stack []string, policy TagPolicy) bool {
+	for _, tag := range stack {
+		if policy.PreserveText[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeAttrValue escapes the characters that would otherwise break out of
+// the double-quoted attribute value mangleHTMLParser writes.
+func escapeAttrValue(s string) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, "\"", "&quot;", -1)
+	return s
+}
+
 // Performs the core mangling function on a word. The approach is to hash the
 // word and the secret salt, then map the hash value into the available corpus
 // words of the appropriate length (or the longest available length, padding
@@ -0,0 +1,205 @@
+package mangle
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"unicode"
+)
+
+// AuditSink receives a callback for every replacement Mangle makes, letting
+// callers build a log that Unmangle can later use to reverse a mangled
+// stream. Because mangleWord hashes the plaintext word and the secret salt
+// to pick a replacement, reversal is otherwise impossible - the audit sink
+// is what turns Mangle into a keyed, reversible pseudonymization primitive,
+// while leaving it one-way by default when no sink is configured.
+type AuditSink interface {
+	// Record is called once per replacement, with the byte offset of the
+	// replacement within the mangled output and a short kind label ("word",
+	// or a Detector kind such as "email").
+	Record(original, replacement string, offset int64, kind string)
+}
+
+// AuditSource looks up the original value for a replacement found at a
+// given offset in a mangled stream, as logged by a matching AuditSink.
+type AuditSource interface {
+	Lookup(replacement string, offset int64) (original string, ok bool)
+}
+
+// auditRecord is the plaintext shape of a single audit log row before
+// encryption. Hash is sha256(original+secret); Original is stored in the
+// same row, so the plaintext is protected by the AES-GCM encryption of each
+// row, not by the hash.
+type auditRecord struct {
+	Hash        string `json:"hash"`
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+	Offset      int64  `json:"offset"`
+	Kind        string `json:"kind"`
+}
+
+// FileAuditSink appends an AES-GCM encrypted, base64-encoded, newline
+// delimited audit log to a file, one line per replacement Mangle makes.
+type FileAuditSink struct {
+	file   *os.File
+	gcm    cipher.AEAD
+	secret string
+}
+
+// NewFileAuditSink opens (creating if necessary) an append-only audit log
+// at path, encrypting each row with encryptionKey - which must be 16, 24 or
+// 32 bytes long, selecting AES-128/192/256-GCM respectively - and hashing
+// logged words with secret (typically the same Secret as the Mangle using
+// this sink).
+func NewFileAuditSink(path string, encryptionKey []byte, secret string) (*FileAuditSink, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditSink{file: file, gcm: gcm, secret: secret}, nil
+}
+
+// Record implements AuditSink.
+func (s *FileAuditSink) Record(original, replacement string, offset int64, kind string) {
+	hash := sha256.Sum256([]byte(original + s.secret))
+	record := auditRecord{
+		Hash:        fmt.Sprintf("%x", hash),
+		Original:    original,
+		Replacement: replacement,
+		Offset:      offset,
+		Kind:        kind,
+	}
+	plaintext, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return
+	}
+	ciphertext := s.gcm.Seal(nonce, nonce, plaintext, nil)
+	fmt.Fprintln(s.file, base64.StdEncoding.EncodeToString(ciphertext))
+}
+
+// Close closes the underlying log file.
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// FileAuditSource reads back a log written by FileAuditSink, indexing it by
+// replacement text and offset for use with Unmangle.
+type FileAuditSource struct {
+	byKey map[string]string
+}
+
+// OpenFileAuditSource decrypts and indexes an audit log previously written
+// by NewFileAuditSink with the same encryptionKey.
+func OpenFileAuditSource(path string, encryptionKey []byte) (*FileAuditSource, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	source := &FileAuditSource{byKey: make(map[string]string)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		ciphertext, err := base64.StdEncoding.DecodeString(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if len(ciphertext) < gcm.NonceSize() {
+			return nil, errors.New("mangle: audit log record is truncated")
+		}
+		nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+		plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+		if err != nil {
+			return nil, err
+		}
+		var record auditRecord
+		if err := json.Unmarshal(plaintext, &record); err != nil {
+			return nil, err
+		}
+		source.byKey[auditKey(record.Replacement, record.Offset)] = record.Original
+	}
+	return source, scanner.Err()
+}
+
+// Lookup implements AuditSource.
+func (s *FileAuditSource) Lookup(replacement string, offset int64) (string, bool) {
+	original, ok := s.byKey[auditKey(replacement, offset)]
+	return original, ok
+}
+
+func auditKey(replacement string, offset int64) string {
+	return fmt.Sprintf("%d:%s", offset, replacement)
+}
+
+// Unmangle reverses a mangled stream given the AuditSource built from that
+// run's audit log, substituting back the original text for every
+// replacement it can find a matching (offset, replacement) entry for and
+// leaving anything it can't account for (non-word punctuation, or a
+// replacement with no log entry) unchanged. This lets a developer without
+// the Secret debug a test failure against sanitized data, using a log
+// shared only with whoever holds the encryption key.
+func Unmangle(r io.Reader, w io.Writer, source AuditSource) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var offset, wordOffset int64
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		replacement := string(word)
+		if original, ok := source.Lookup(replacement, wordOffset); ok {
+			fmt.Fprint(w, original)
+		} else {
+			fmt.Fprint(w, replacement)
+		}
+		word = word[0:0]
+	}
+
+	for _, r := range string(data) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if len(word) == 0 {
+				wordOffset = offset
+			}
+			word = append(word, r)
+		} else {
+			flush()
+			fmt.Fprint(w, string(r))
+		}
+		offset += int64(len(string(r)))
+	}
+	flush()
+	return nil
+}
@@ -0,0 +1,90 @@
+package mangle
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"unicode"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/lexers"
+)
+
+// MangleCode operates on source code, tokenizing it with the Chroma lexer
+// named by lexerName (see DetectLexer when lexerName is empty) and mangling
+// only the tokens that carry user data - identifiers, string literals and
+// comments. Keywords, operators, punctuation, numeric literals and
+// whitespace are emitted byte-for-byte, so the output stays syntactically
+// valid and parseable, unlike MangleHTML's indiscriminate handling of
+// embedded script/style content.
+func (m Mangle) MangleCode(r io.Reader, w io.Writer, lexerName string) error {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	text := string(source)
+
+	lexer := m.DetectLexer(lexerName, text)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, text)
+	if err != nil {
+		return err
+	}
+	for _, token := range iterator.Tokens() {
+		fmt.Fprint(w, m.mangleToken(token))
+	}
+	return nil
+}
+
+// DetectLexer looks up the Chroma lexer registered under name, falling back
+// to content based analysis (e.g. shebangs, keywords) when name is empty or
+// unknown. It returns nil if no lexer could be determined.
+func (m Mangle) DetectLexer(name string, source string) chroma.Lexer {
+	if name != "" {
+		if lexer := lexers.Get(name); lexer != nil {
+			return lexer
+		}
+	}
+	return lexers.Analyse(source)
+}
+
+// mangleToken mangles a single Chroma token according to its type. Name
+// tokens (identifiers) are mangled as a single word so the replacement stays
+// a valid identifier; string literal and comment tokens are run through
+// MangleString, which already leaves quote and comment delimiters untouched
+// since they are not letters or numbers. Every other token type is passed
+// through unchanged.
+func (m Mangle) mangleToken(token chroma.Token) string {
+	switch {
+	case token.Type.InCategory(chroma.LiteralString), token.Type.InCategory(chroma.Comment):
+		return m.MangleString(token.Value)
+	case token.Type.InCategory(chroma.Name):
+		return m.mangleIdentifier(token.Value)
+	default:
+		return token.Value
+	}
+}
+
+// mangleIdentifier mangles s as a single word, then strips any corpus
+// characters that would not be valid in an identifier (padding with "x" if
+// stripping leaves it shorter than the original) so the replacement can be
+// substituted into source code without breaking the parse.
+func (m Mangle) mangleIdentifier(s string) string {
+	runes := []rune(s)
+	replacement := []rune(m.mangleWord(runes))
+
+	var valid []rune
+	for _, r := range replacement {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			valid = append(valid, r)
+		}
+	}
+	for len(valid) < len(runes) {
+		valid = append(valid, 'x')
+	}
+	return string(valid)
+}
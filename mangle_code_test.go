@@ -0,0 +1,42 @@
+package mangle_test
+
+import (
+	"bytes"
+	"github.com/grugnog/mangle"
+	"strings"
+	"testing"
+)
+
+var codetests = []struct {
+	in  string
+	out string
+}{
+	// Keywords, operators, punctuation and numeric literals are untouched;
+	// only the identifier and string literal are mangled.
+	{
+		`func main() { fmt.Println("Hello world!") }`,
+		`func kkkk() { ggg.Sssssss("Nnnnn mmmmm!") }`,
+	},
+	// Comments are mangled like strings, with the delimiters left alone.
+	{
+		"// Antidisestablishmentarianism\nfunc a() {}",
+		"// Sssssss                     \nfunc a() {}",
+	},
+}
+
+// Tests the source code mangler with a Go lexer.
+func TestMangleCode(t *testing.T) {
+	mangler := mangle.Mangle{Corpus: corpus, Secret: salta}
+	for _, tt := range codetests {
+		r := strings.NewReader(tt.in)
+		w := new(bytes.Buffer)
+		err := mangler.MangleCode(r, w, "go")
+		if err != nil {
+			t.Errorf("MangleCode(%q) error %q", tt.in, err)
+		}
+		out := w.String()
+		if out != tt.out {
+			t.Errorf("MangleCode(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package mangle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Detector finds and masks a single category of structured, format
+// sensitive data - emails, URLs, phone numbers, dates, IP addresses - ahead
+// of the generic word-by-word mangler, so the replacement keeps the
+// original's shape instead of turning into unrelated corpus words.
+type Detector interface {
+	// Match returns the byte range [start, end) of the next occurrence of
+	// this detector's pattern in text, and a short kind label for it. It
+	// returns start == -1 when there is no match.
+	Match(text []byte) (start, end int, kind string)
+	// Mangle deterministically replaces match, using secret as a salt so
+	// the same input always masks to the same output.
+	Mangle(match []byte, secret string) []byte
+}
+
+// detectorMatch returns the leftmost match across all of m.Detectors,
+// breaking ties between equal start offsets in favour of the longer match.
+func (m Mangle) detectorMatch(text []byte) (Detector, int, int, string) {
+	bestStart, bestEnd := -1, -1
+	var best Detector
+	var bestKind string
+	for _, d := range m.Detectors {
+		start, end, kind := d.Match(text)
+		if start < 0 {
+			continue
+		}
+		if bestStart == -1 || start < bestStart || (start == bestStart && end > bestEnd) {
+			best, bestStart, bestEnd, bestKind = d, start, end, kind
+		}
+	}
+	return best, bestStart, bestEnd, bestKind
+}
+
+// deterministicUint32 hashes data together with secret and folds the result
+// down to a uint32, using the same SHA256+CRC32 construction as mangleWord
+// so detector output stays deterministic for a given Secret.
+func deterministicUint32(data []byte, secret string) uint32 {
+	hash := sha256.New()
+	hash.Write(data)
+	hash.Write([]byte(secret))
+	return crc32.ChecksumIEEE(hash.Sum(nil))
+}
+
+const syntheticAlphabet = "abcdefghijklmnopqrstuvwxyz"
+
+// syntheticWord deterministically generates an n letter lowercase word from
+// seed and secret. It is used by detectors that, unlike mangleWord, have no
+// corpus to draw replacements from.
+func syntheticWord(n int, seed []byte, secret string) string {
+	if n <= 0 {
+		return ""
+	}
+	out := make([]byte, n)
+	for i := 0; i < n; i++ {
+		// seed is often a sub-slice of the caller's input text, so copy it
+		// before appending: appending directly to seed could write into the
+		// backing array past its length, corrupting text beyond the match.
+		h := deterministicUint32(append(append([]byte{}, seed...), byte(i)), secret)
+		out[i] = syntheticAlphabet[h%uint32(len(syntheticAlphabet))]
+	}
+	return string(out)
+}
+
+// EmailDetector masks the local part of RFC 5322 style email addresses,
+// keeping the domain (e.g. "@example.com") intact so mangled data still
+// groups by domain.
+type EmailDetector struct{}
+
+var emailRegexp = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+
+func (EmailDetector) Match(text []byte) (int, int, string) {
+	loc := emailRegexp.FindIndex(text)
+	if loc == nil {
+		return -1, -1, ""
+	}
+	return loc[0], loc[1], "email"
+}
+
+func (EmailDetector) Mangle(match []byte, secret string) []byte {
+	at := strings.IndexByte(string(match), '@')
+	if at < 0 {
+		return match
+	}
+	local, domain := match[:at], match[at:]
+	return []byte(syntheticWord(len(local), match, secret) + string(domain))
+}
+
+// URLDetector masks the path and query of http(s) URLs, preserving the
+// scheme and host so mangled links still point at the same server.
+type URLDetector struct{}
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+func (URLDetector) Match(text []byte) (int, int, string) {
+	loc := urlRegexp.FindIndex(text)
+	if loc == nil {
+		return -1, -1, ""
+	}
+	return loc[0], loc[1], "url"
+}
+
+func (URLDetector) Mangle(match []byte, secret string) []byte {
+	parsed, err := url.Parse(string(match))
+	if err != nil {
+		return match
+	}
+	if parsed.Path != "" && parsed.Path != "/" {
+		segments := strings.Split(parsed.Path, "/")
+		for i, segment := range segments {
+			if segment == "" {
+				continue
+			}
+			segments[i] = syntheticWord(len(segment), []byte(segment), secret)
+		}
+		parsed.Path = strings.Join(segments, "/")
+	}
+	if parsed.RawQuery != "" {
+		pairs := strings.Split(parsed.RawQuery, "&")
+		for i, pair := range pairs {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) == 2 {
+				kv[1] = syntheticWord(len(kv[1]), []byte(pair), secret)
+				pairs[i] = strings.Join(kv, "=")
+			}
+		}
+		parsed.RawQuery = strings.Join(pairs, "&")
+	}
+	return []byte(parsed.String())
+}
+
+// PhoneDetector masks E.164-ish phone numbers, replacing each digit with a
+// deterministically chosen digit and leaving formatting punctuation (+, (),
+// spaces, -) untouched, so "+1 (123) 456-7890" keeps its shape. A bare run
+// of 10+ digits (an order ID, account number, zip+4, ...) is not a phone
+// number without at least one of a leading "+" or an internal separator, so
+// Match requires the match to contain one of "+()- " before accepting it.
+type PhoneDetector struct{}
+
+var phoneRegexp = regexp.MustCompile(`\+?\d{1,3}[ -]?\(?\d{2,4}\)?[ -]?\d{3,4}[ -]?\d{4}`)
+
+func (PhoneDetector) Match(text []byte) (int, int, string) {
+	for _, loc := range phoneRegexp.FindAllIndex(text, -1) {
+		if hasPhoneFormatting(text[loc[0]:loc[1]]) {
+			return loc[0], loc[1], "phone"
+		}
+	}
+	return -1, -1, ""
+}
+
+// hasPhoneFormatting reports whether match contains a leading country-code
+// marker or an internal separator, distinguishing a formatted phone number
+// from a bare run of digits.
+func hasPhoneFormatting(match []byte) bool {
+	for _, b := range match {
+		switch b {
+		case '+', '(', ')', ' ', '-':
+			return true
+		}
+	}
+	return false
+}
+
+func (PhoneDetector) Mangle(match []byte, secret string) []byte {
+	out := make([]byte, len(match))
+	for i, b := range match {
+		if b < '0' || b > '9' {
+			out[i] = b
+			continue
+		}
+		seed := append(append([]byte{}, match...), byte(i))
+		out[i] = byte('0' + deterministicUint32(seed, secret)%10)
+	}
+	return out
+}
+
+// DateDetector masks ISO-8601 dates (YYYY-MM-DD) by jittering them by a
+// deterministic number of days within +/- WindowDays, preserving the
+// calendar relationships between dates derived from the same day while
+// hiding the real one.
+type DateDetector struct {
+	// WindowDays bounds how far a date may jitter in either direction.
+	// Zero means the default of 30 days.
+	WindowDays int
+}
+
+var dateRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+func (DateDetector) Match(text []byte) (int, int, string) {
+	loc := dateRegexp.FindIndex(text)
+	if loc == nil {
+		return -1, -1, ""
+	}
+	return loc[0], loc[1], "date"
+}
+
+func (d DateDetector) Mangle(match []byte, secret string) []byte {
+	t, err := time.Parse("2006-01-02", string(match))
+	if err != nil {
+		return match
+	}
+	window := d.WindowDays
+	if window <= 0 {
+		window = 30
+	}
+	offset := int(deterministicUint32(match, secret)%uint32(2*window+1)) - window
+	return []byte(t.AddDate(0, 0, offset).Format("2006-01-02"))
+}
+
+// IPDetector masks IPv4 addresses, replacing each octet with a
+// deterministically chosen value that keeps both the address's dotted-quad
+// shape and each octet's original digit width (so the replacement is the
+// same byte length as the match, which Mangle.AuditSink/Unmangle rely on).
+type IPDetector struct{}
+
+var ipv4Regexp = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+func (IPDetector) Match(text []byte) (int, int, string) {
+	loc := ipv4Regexp.FindIndex(text)
+	if loc == nil {
+		return -1, -1, ""
+	}
+	return loc[0], loc[1], "ip"
+}
+
+func (IPDetector) Mangle(match []byte, secret string) []byte {
+	octets := strings.Split(string(match), ".")
+	for i := range octets {
+		seed := append(append([]byte{}, match...), byte(i))
+		octets[i] = mangleOctet(octets[i], deterministicUint32(seed, secret))
+	}
+	return []byte(strings.Join(octets, "."))
+}
+
+// mangleOctet picks a replacement value for an IPv4 octet with the same
+// digit width as original (1 digit: 0-9, 2 digits: 10-99, 3 digits:
+// 100-255), so the dotted-quad keeps both a valid shape and its original
+// byte length.
+func mangleOctet(original string, h uint32) string {
+	switch len(original) {
+	case 1:
+		return strconv.Itoa(int(h % 10))
+	case 2:
+		return strconv.Itoa(int(h%90) + 10)
+	default:
+		return strconv.Itoa(int(h%156) + 100)
+	}
+}
+
+// IPv6Detector masks IPv6 addresses, replacing each hextet's hex digits
+// with deterministically chosen ones of the same digit width and case,
+// leaving the colons - including any "::" zero-compression - exactly where
+// they were, so the replacement is the same byte length as the match.
+type IPv6Detector struct{}
+
+var ipv6Regexp = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,7}:` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,6}:[0-9A-Fa-f]{1,4}\b` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,5}(?::[0-9A-Fa-f]{1,4}){1,2}\b` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,4}(?::[0-9A-Fa-f]{1,4}){1,3}\b` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,3}(?::[0-9A-Fa-f]{1,4}){1,4}\b` +
+	`|\b(?:[0-9A-Fa-f]{1,4}:){1,2}(?::[0-9A-Fa-f]{1,4}){1,5}\b` +
+	`|\b[0-9A-Fa-f]{1,4}:(?:(?::[0-9A-Fa-f]{1,4}){1,6})\b` +
+	`|:(?:(?::[0-9A-Fa-f]{1,4}){1,7}|:)`)
+
+func init() {
+	// Prefer the longest alternative, so "2001:db8::1" is matched whole
+	// rather than stopping at "2001:db8::".
+	ipv6Regexp.Longest()
+}
+
+func (IPv6Detector) Match(text []byte) (int, int, string) {
+	loc := ipv6Regexp.FindIndex(text)
+	if loc == nil {
+		return -1, -1, ""
+	}
+	return loc[0], loc[1], "ipv6"
+}
+
+const hexAlphabet = "0123456789abcdef"
+
+func (IPv6Detector) Mangle(match []byte, secret string) []byte {
+	out := make([]byte, len(match))
+	var run []byte
+	runStart := 0
+	flush := func() {
+		for i, b := range run {
+			seed := append(append([]byte{}, match...), byte(runStart+i))
+			c := hexAlphabet[deterministicUint32(seed, secret)%16]
+			if b >= 'A' && b <= 'F' {
+				c -= 'a' - 'A'
+			}
+			out[runStart+i] = c
+		}
+		run = run[:0]
+	}
+	for i, b := range match {
+		if isHexDigit(b) {
+			if len(run) == 0 {
+				runStart = i
+			}
+			run = append(run, b)
+		} else {
+			flush()
+			out[i] = b
+		}
+	}
+	flush()
+	return out
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// builtinDetectors maps the -detectors flag names used by manglefile to
+// their Detector implementations.
+var builtinDetectors = map[string]Detector{
+	"email": EmailDetector{},
+	"url":   URLDetector{},
+	"phone": PhoneDetector{},
+	"date":  DateDetector{},
+	"ip":    IPDetector{},
+	"ipv6":  IPv6Detector{},
+}
+
+// ParseDetectors resolves a comma separated list of detector names (as
+// accepted by builtinDetectors) into a slice suitable for Mangle.Detectors.
+// Unknown names are reported via the returned error.
+func ParseDetectors(names string) ([]Detector, error) {
+	if names == "" {
+		return nil, nil
+	}
+	var detectors []Detector
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		detector, ok := builtinDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", name)
+		}
+		detectors = append(detectors, detector)
+	}
+	return detectors, nil
+}
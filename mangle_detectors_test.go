@@ -0,0 +1,68 @@
+package mangle_test
+
+import (
+	"github.com/grugnog/mangle"
+	"regexp"
+	"testing"
+)
+
+// Tests that each built-in detector produces deterministic, format
+// preserving output: the same input always mangles to the same result, and
+// the result still matches the detector's own pattern.
+func TestDetectors(t *testing.T) {
+	detectortests := []struct {
+		kind    string
+		pattern *regexp.Regexp
+		in      string
+	}{
+		{"email", regexp.MustCompile(`^[a-z]+@example\.com$`), "user@example.com"},
+		{"url", regexp.MustCompile(`^https://example\.com/[a-z]+$`), "https://example.com/path"},
+		{"phone", regexp.MustCompile(`^\+\d \(\d{3}\) \d{3}-\d{4}$`), "+1 (123) 456-7890"},
+		{"date", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`), "2024-01-15"},
+		{"ip", regexp.MustCompile(`^\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}$`), "192.168.1.1"},
+		{"ipv6", regexp.MustCompile(`^[0-9a-f:]+$`), "2001:db8::1"},
+	}
+	for _, tt := range detectortests {
+		detectors, err := mangle.ParseDetectors(tt.kind)
+		if err != nil {
+			t.Fatalf("ParseDetectors(%q) error %q", tt.kind, err)
+		}
+		mangler := mangle.Mangle{Corpus: corpus, Secret: salta, Detectors: detectors}
+		out := mangler.MangleString(tt.in)
+		if !tt.pattern.MatchString(out) {
+			t.Errorf("MangleString(%q) => %q, does not match %s", tt.in, out, tt.pattern)
+		}
+		if again := mangler.MangleString(tt.in); again != out {
+			t.Errorf("MangleString(%q) is not deterministic: %q != %q", tt.in, again, out)
+		}
+		other := mangle.Mangle{Corpus: corpus, Secret: saltb, Detectors: detectors}
+		if otherOut := other.MangleString(tt.in); otherOut == out {
+			t.Errorf("MangleString(%q) => %q for both secrets, want different output", tt.in, out)
+		}
+	}
+}
+
+// Tests that ParseDetectors rejects unknown detector names.
+func TestParseDetectorsUnknown(t *testing.T) {
+	if _, err := mangle.ParseDetectors("email,bogus"); err == nil {
+		t.Errorf("ParseDetectors(%q) expected an error for unknown detector", "email,bogus")
+	}
+}
+
+// Tests that PhoneDetector only matches formatted phone numbers, leaving a
+// bare digit run like an order ID or account number to the word mangler
+// instead of mistaking it for a phone number.
+func TestPhoneDetectorRequiresFormatting(t *testing.T) {
+	detectors, err := mangle.ParseDetectors("phone")
+	if err != nil {
+		t.Fatalf("ParseDetectors(%q) error %q", "phone", err)
+	}
+	sink := newMemorySink()
+	mangler := mangle.Mangle{Corpus: corpus, Secret: salta, Detectors: detectors, AuditSink: sink}
+	mangler.MangleString("order id 1234567890")
+	for key, kind := range sink.kindByKey {
+		if kind == "phone" {
+			t.Errorf("MangleString recorded %q as a phone match, want the word mangler to handle it", key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package mangle
+
+import "strings"
+
+// namedEntities maps runes that commonly arrive in HTML text nodes as
+// character references (and would otherwise round-trip as raw UTF-8) back
+// to the named entity they are most often written as. This is not an
+// exhaustive copy of the HTML5 entity table - just the references common
+// enough in real-world markup (typography, currency, legal marks) to be
+// worth preserving byte-for-byte across a mangle pass.
+var namedEntities = map[rune]string{
+	'<':  "lt",
+	'>':  "gt",
+	'&':  "amp",
+	'"':  "quot",
+	'\'': "apos",
+	' ':  "nbsp",
+	'«':  "laquo",
+	'»':  "raquo",
+	'°':  "deg",
+	'©':  "copy",
+	'®':  "reg",
+	'™':  "trade",
+	'…':  "hellip",
+	'–':  "ndash",
+	'—':  "mdash",
+	'‘':  "lsquo",
+	'’':  "rsquo",
+	'“':  "ldquo",
+	'”':  "rdquo",
+	'é':  "eacute",
+	'è':  "egrave",
+	'à':  "agrave",
+	'ü':  "uuml",
+	'ö':  "ouml",
+	'ä':  "auml",
+	'ß':  "szlig",
+	'ç':  "ccedil",
+	'ñ':  "ntilde",
+}
+
+// escapeHTMLEntities re-encodes s, replacing any rune present in
+// namedEntities with its named character reference. It is the inverse of
+// the decoding the HTML tokenizer performs on text nodes, used when
+// Mangle.PreserveEntities is set so mangled HTML text stays valid markup.
+func escapeHTMLEntities(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if name, ok := namedEntities[r]; ok {
+			b.WriteString("&")
+			b.WriteString(name)
+			b.WriteString(";")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package mangle
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// MangleMarkdown operates on CommonMark, walking the parsed AST and
+// re-emitting structural markup (heading markers, list bullets, blockquote
+// markers, emphasis runs, link/image brackets and targets, code fences and
+// their info strings, raw HTML) while routing only the textual contents of
+// Text, Paragraph and Heading nodes through MangleString. Raw HTML, link
+// targets, info strings and list markers are copied from the source; the
+// other markup is written in one fixed form rather than copied: ATX "#"
+// headings, "*" emphasis, "```" code fences (also for indented code blocks)
+// and "---" thematic breaks. Fenced code blocks whose info string names a known
+// Chroma lexer are routed through MangleCode instead. Autolinks, inline code
+// spans and link destinations are passed through verbatim, so mangled dumps
+// of READMEs, issues and wikis stay renderable and link-checkable.
+func (m Mangle) MangleMarkdown(r io.Reader, w io.Writer) error {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	root := goldmark.DefaultParser().Parse(text.NewReader(source))
+	return ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		m.mangleMarkdownNode(n, source, w, entering)
+		return ast.WalkContinue, nil
+	})
+}
+
+// mangleMarkdownNode renders a single AST node, entering or leaving, writing
+// either verbatim source bytes (for structural markup) or mangled text (for
+// prose) to w.
+func (m Mangle) mangleMarkdownNode(n ast.Node, source []byte, w io.Writer, entering bool) {
+	switch node := n.(type) {
+	case *ast.Heading:
+		if entering {
+			fmt.Fprintf(w, "%s ", strings.Repeat("#", node.Level))
+		} else {
+			fmt.Fprint(w, "\n\n")
+		}
+	case *ast.Paragraph:
+		if !entering {
+			fmt.Fprint(w, "\n\n")
+		}
+	case *ast.TextBlock:
+		if !entering {
+			fmt.Fprint(w, "\n")
+		}
+	case *ast.Text:
+		if entering {
+			value := string(node.Segment.Value(source))
+			if node.Parent() != nil && node.Parent().Kind() == ast.KindCodeSpan {
+				// Inline code spans are passed through verbatim.
+				fmt.Fprint(w, value)
+			} else {
+				fmt.Fprint(w, m.MangleString(value))
+			}
+			if node.SoftLineBreak() {
+				fmt.Fprint(w, "\n")
+			}
+			if node.HardLineBreak() {
+				fmt.Fprint(w, "  \n")
+			}
+		}
+	case *ast.String:
+		if entering {
+			fmt.Fprint(w, m.MangleString(string(node.Value)))
+		}
+	case *ast.Emphasis:
+		fmt.Fprint(w, strings.Repeat("*", node.Level))
+	case *ast.CodeSpan:
+		fmt.Fprint(w, "`")
+	case *ast.AutoLink:
+		if entering {
+			fmt.Fprintf(w, "<%s>", node.URL(source))
+		}
+	case *ast.Link:
+		if entering {
+			fmt.Fprint(w, "[")
+		} else {
+			fmt.Fprintf(w, "](%s", node.Destination)
+			if len(node.Title) > 0 {
+				fmt.Fprintf(w, " %q", node.Title)
+			}
+			fmt.Fprint(w, ")")
+		}
+	case *ast.Image:
+		if entering {
+			fmt.Fprint(w, "![")
+		} else {
+			fmt.Fprintf(w, "](%s", node.Destination)
+			if len(node.Title) > 0 {
+				fmt.Fprintf(w, " %q", node.Title)
+			}
+			fmt.Fprint(w, ")")
+		}
+	case *ast.ThematicBreak:
+		if entering {
+			fmt.Fprint(w, "---\n\n")
+		}
+	case *ast.Blockquote:
+		if entering {
+			fmt.Fprint(w, "> ")
+		} else {
+			fmt.Fprint(w, "\n")
+		}
+	case *ast.ListItem:
+		if entering {
+			fmt.Fprint(w, listItemMarker(node))
+		} else {
+			fmt.Fprint(w, "\n")
+		}
+	case *ast.FencedCodeBlock:
+		if entering {
+			info := ""
+			if node.Info != nil {
+				info = string(node.Info.Segment.Value(source))
+			}
+			fmt.Fprintf(w, "```%s\n", info)
+			fmt.Fprint(w, m.mangleCodeBlockLines(node, source, info))
+			fmt.Fprint(w, "```\n\n")
+		}
+	case *ast.CodeBlock:
+		if entering {
+			fmt.Fprint(w, "```\n")
+			fmt.Fprint(w, m.mangleCodeBlockLines(node, source, ""))
+			fmt.Fprint(w, "```\n\n")
+		}
+	case *ast.HTMLBlock:
+		if entering {
+			for i := 0; i < node.Lines().Len(); i++ {
+				line := node.Lines().At(i)
+				fmt.Fprint(w, string(line.Value(source)))
+			}
+		}
+	case *ast.RawHTML:
+		if entering {
+			for i := 0; i < node.Segments.Len(); i++ {
+				segment := node.Segments.At(i)
+				fmt.Fprint(w, string(segment.Value(source)))
+			}
+		}
+	}
+}
+
+// listItemMarker renders the bullet (and, for ordered lists, the running
+// number) that introduced item in the source, so "1. ", "2. ", "- ", "* "
+// and "+ " are all reproduced instead of being flattened to "- ".
+func listItemMarker(item *ast.ListItem) string {
+	list, _ := item.Parent().(*ast.List)
+	if list == nil || !list.IsOrdered() {
+		marker := byte('-')
+		if list != nil {
+			marker = list.Marker
+		}
+		return fmt.Sprintf("%c ", marker)
+	}
+	n := list.Start
+	for sibling := item.PreviousSibling(); sibling != nil; sibling = sibling.PreviousSibling() {
+		n++
+	}
+	return fmt.Sprintf("%d%c ", n, list.Marker)
+}
+
+// mangleCodeBlockLines mangles the literal content of a fenced or indented
+// code block. If info names a Chroma lexer, MangleCode is used so the
+// resulting snippet stays syntactically valid; otherwise the lines are
+// mangled as plain text.
+func (m Mangle) mangleCodeBlockLines(node ast.Node, source []byte, info string) string {
+	var content strings.Builder
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		content.Write(line.Value(source))
+	}
+
+	lexer := ""
+	if info != "" {
+		if fields := strings.Fields(info); len(fields) > 0 {
+			lexer = fields[0]
+		}
+	}
+	if lexer != "" && m.DetectLexer(lexer, "") != nil {
+		var out strings.Builder
+		if err := m.MangleCode(strings.NewReader(content.String()), &out, lexer); err == nil {
+			return out.String()
+		}
+	}
+	return m.MangleString(content.String())
+}
@@ -0,0 +1,57 @@
+package mangle_test
+
+import (
+	"bytes"
+	"github.com/grugnog/mangle"
+	"strings"
+	"testing"
+)
+
+var markdowntests = []struct {
+	in  string
+	out string
+}{
+	// Heading markers, emphasis runs and link brackets/targets survive;
+	// only the prose and link text are mangled.
+	{
+		"# Hello world!\n",
+		"# Nnnnn mmmmm!\n\n",
+	},
+	{
+		"Welcome to the [World Wide Web](http://www.w3.org/).\n",
+		"Uuuuuuu ff iii [Nnnnn Llll Hhh](http://www.w3.org/).\n\n",
+	},
+	// Inline code spans are left untouched.
+	{
+		"Run `go test` now.\n",
+		"Iii `go test` iii.\n\n",
+	},
+	// List bullets are reproduced from the source, not flattened to "-":
+	// ordered lists keep their running number and marker, "*"/"+" unordered
+	// lists keep their own marker character.
+	{
+		"1. First item\n2. Second item\n",
+		"1. Nnnnn llll\n\n2. Pppppp llll\n\n",
+	},
+	{
+		"* One\n* Two\n",
+		"* Iii\n\n* Hhh\n\n",
+	},
+}
+
+// Tests the markdown mangler preserves CommonMark structure.
+func TestMangleMarkdown(t *testing.T) {
+	mangler := mangle.Mangle{Corpus: corpus, Secret: salta}
+	for _, tt := range markdowntests {
+		r := strings.NewReader(tt.in)
+		w := new(bytes.Buffer)
+		err := mangler.MangleMarkdown(r, w)
+		if err != nil {
+			t.Errorf("MangleMarkdown(%q) error %q", tt.in, err)
+		}
+		out := w.String()
+		if out != tt.out {
+			t.Errorf("MangleMarkdown(%q) => %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mangle
+
+// TagPolicy controls how MangleHTML treats specific tags and attributes,
+// instead of mangling every piece of text and preserving every attribute
+// indiscriminately.
+type TagPolicy struct {
+	// PreserveText lists tag names whose text content is copied verbatim,
+	// e.g. "script", "style", "pre", "code".
+	PreserveText map[string]bool
+	// PreserveAttrs maps a tag name to the attribute names on it that are
+	// always kept verbatim, even if also listed in MangleAttrs. The tag
+	// name "*" applies to every tag.
+	PreserveAttrs map[string][]string
+	// MangleAttrs maps a tag name to the attribute names on it whose value
+	// should be mangled rather than copied as-is, e.g. "title", "alt". The
+	// tag name "*" applies to every tag.
+	MangleAttrs map[string][]string
+}
+
+// DefaultTagPolicy returns a TagPolicy suitable for masking realistic HTML:
+// links still resolve, images still load, forms still submit, and embedded
+// CSS/JS remain syntactically valid, while title attributes are mangled like
+// regular content. Other attributes are copied verbatim.
+func DefaultTagPolicy() TagPolicy {
+	return TagPolicy{
+		PreserveText: map[string]bool{
+			"script": true,
+			"style":  true,
+			"pre":    true,
+			"code":   true,
+		},
+		PreserveAttrs: map[string][]string{
+			"a":    {"href"},
+			"img":  {"src", "alt"},
+			"form": {"action"},
+		},
+		MangleAttrs: map[string][]string{
+			"*": {"title"},
+		},
+	}
+}
+
+// mangleAttr reports whether the value of attr on tag should be mangled
+// rather than copied verbatim. PreserveAttrs always wins over MangleAttrs.
+func (p TagPolicy) mangleAttr(tag, attr string) bool {
+	if contains(p.PreserveAttrs[tag], attr) || contains(p.PreserveAttrs["*"], attr) {
+		return false
+	}
+	return contains(p.MangleAttrs[tag], attr) || contains(p.MangleAttrs["*"], attr)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -90,14 +90,16 @@ var markuptests = []struct {
 	// Full page tests.
 	{"<html><head><title>A Simple HTML Example</title></head><body><h2>HTML is Easy To Learn</h2><p>Welcome!</p></body></html>", "<html><head><title>B Pppppp KKKK Uuuuuuu</title></head><body><h2>KKKK ee Jjjj Ee Nnnnn</h2><p>Uuuuuuu!</p></body></html>"},
 	{"<!doctype html><title>Short HTML5</title>", "<!doctype html><title>Mmmmm MMMMM</title>"},
-	// Snippet tests.
-	// TODO: Would be nice to be able to preserve select tag/attribute combinations (e.g. a:href).
+	// Snippet tests. Attribute values are preserved verbatim by default
+	// (the zero-value TagPolicy mangles nothing) - use DefaultTagPolicy to
+	// mangle select attributes such as title, see TestHTMLTagPolicy.
 	{"<h2>HTML is Easy To Learn</h2><p>Welcome to the world of the <a href=\"http://www.w3.org/\">World Wide Web</a>.</p>", "<h2>KKKK ee Jjjj Ee Nnnnn</h2><p>Uuuuuuu ff iii mmmmm ff iii <a href=\"http://www.w3.org/\">Nnnnn Llll Hhh</a>.</p>"},
 	{"<article><header><h1>Blog post</h1></header><nav><ul><li><a href=\"..\">Next post</a></li></ul></nav><p>Some article content!</p></article>", "<article><header><h1>Jjjj kkkk</h1></header><nav><ul><li><a href=\"..\">Jjjj kkkk</a></li></ul></nav><p>Jjjj uuuuuuu sssssss!</p></article>"},
-	// Embedded CSS and JS tests.
-	// TODO: Would be nice to be able to whitelist these tags.
+	// Embedded CSS and JS tests. The zero-value TagPolicy preserves no
+	// text, so script/style content is still mangled here - see
+	// TestHTMLTagPolicy for whitelisting these tags.
 	{"<head><style>body {background-color:lightgray}</style></head><body><h1>This is a heading</h1></body>", "<head><style>kkkk {ttttttt   -nnnnn:uuuuuuu  }</style></head><body><h1>Llll ee a uuuuuuu</h1></body>"},
-	{"<head><script type='text/javascript'>$(document).ready(function() {}}</script></head><body><h1>This is a heading</h1></body>", "<head><script type='text/javascript'>$(sssssss ).ooooo(sssssss () {}}</script></head><body><h1>Llll ee a uuuuuuu</h1></body>"},
+	{"<head><script type=\"text/javascript\">$(document).ready(function() {}}</script></head><body><h1>This is a heading</h1></body>", "<head><script type=\"text/javascript\">$(sssssss ).ooooo(sssssss () {}}</script></head><body><h1>Llll ee a uuuuuuu</h1></body>"},
 }
 
 // Tests HTML based interface with markup.
@@ -117,6 +119,47 @@ func TestHTMLMarkup(t *testing.T) {
 	}
 }
 
+// Tests that HTML entities survive a mangle pass when PreserveEntities is
+// set, rather than being emitted as raw decoded UTF-8.
+func TestHTMLPreserveEntities(t *testing.T) {
+	mangler := mangle.Mangle{Corpus: corpus, Secret: salta, PreserveEntities: true}
+	in := "<p>caf&eacute; don&apos;t</p>"
+	want := "<p>llll hhh&apos;b</p>"
+	r := strings.NewReader(in)
+	w := new(bytes.Buffer)
+	err := mangler.MangleHTML(r, w)
+	if err != nil {
+		t.Errorf("MangleHTML(%q) error %q", in, err.Error())
+	}
+	out := w.String()
+	if out != want {
+		t.Errorf("MangleHTML(%q) => %q, want %q", in, out, want)
+	}
+}
+
+// Tests that DefaultTagPolicy preserves script/style content and the href
+// attribute, while mangling a title attribute.
+func TestHTMLTagPolicy(t *testing.T) {
+	mangler := mangle.Mangle{Corpus: corpus, Secret: salta, TagPolicy: mangle.DefaultTagPolicy()}
+	in := "<a href=\"http://www.w3.org/\" title=\"World Wide Web\">Web</a><script>var x = 1;</script>"
+	r := strings.NewReader(in)
+	w := new(bytes.Buffer)
+	err := mangler.MangleHTML(r, w)
+	if err != nil {
+		t.Errorf("MangleHTML(%q) error %q", in, err.Error())
+	}
+	out := w.String()
+	if !strings.Contains(out, "href=\"http://www.w3.org/\"") {
+		t.Errorf("MangleHTML(%q) => %q, href was not preserved", in, out)
+	}
+	if !strings.Contains(out, "var x = 1;") {
+		t.Errorf("MangleHTML(%q) => %q, script content was not preserved", in, out)
+	}
+	if strings.Contains(out, "title=\"World Wide Web\"") {
+		t.Errorf("MangleHTML(%q) => %q, title attribute was not mangled", in, out)
+	}
+}
+
 // Tests that output is dependent on the user defined salt.
 func TestSalts(t *testing.T) {
 	in := "The quick brown fox jumps over the lazy dog"
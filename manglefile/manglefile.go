@@ -22,8 +22,11 @@ import (
 
 var corpus = flag.String("corpus", "corpus.txt", "File containing corpus of words to use as replacements.")
 var secret = flag.String("secret", "", "Required. A secret, used as a salt - must be at least 16 characters.")
-var filetype = flag.String("type", "", "The file type: \"text\" (default) or \"html\".")
+var filetype = flag.String("type", "", "The file type: \"text\" (default), \"html\", \"code\" or \"markdown\".")
+var lexer = flag.String("lexer", "", "When -type=code, the Chroma lexer name to use (e.g. \"go\"). Left blank, the lexer is auto-detected from the source.")
 var profile = flag.Bool("profile", false, "If set, performance profiling data will be stored in this file.")
+var preserveEntities = flag.Bool("preserve-entities", false, "When -type=html, re-encode mangled text with named character references so entity boundaries match the source.")
+var detectors = flag.String("detectors", "", "Comma separated list of structured data detectors to run before the word mangler, e.g. \"email,phone,url,date,ip,ipv6\".")
 
 func main() {
 	flag.Usage = func() {
@@ -60,13 +63,24 @@ func main() {
 		log.Fatalf("Corpus read error: %s", err)
 	}
 
+	// Parse the requested structured data detectors, if any.
+	detectorList, err := mangle.ParseDetectors(*detectors)
+	if err != nil {
+		log.Fatalf("Detectors error: %s", err)
+	}
+
 	// Open stdin and stdout and mangle.
 	w := io.Writer(os.Stdout)
 	r := io.Reader(os.Stdin)
-	mangler := mangle.Mangle{corpus, *secret}
-	if *filetype == "html" {
+	mangler := mangle.Mangle{Corpus: corpus, Secret: *secret, PreserveEntities: *preserveEntities, Detectors: detectorList}
+	switch *filetype {
+	case "html":
 		err = mangler.MangleHTML(r, w)
-	} else {
+	case "code":
+		err = mangler.MangleCode(r, w, *lexer)
+	case "markdown":
+		err = mangler.MangleMarkdown(r, w)
+	default:
 		err = mangler.MangleIO(r, w)
 	}
 	if err != nil {